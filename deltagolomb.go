@@ -14,31 +14,46 @@
  * decoder.Read(buf)
  * // the decoder will call r.Read() as necessary.
  *
- * At present, this code is not optimized for speed.
+ * Bit I/O is buffered through a 64-bit accumulator (see addBits,
+ * addZeroBits and refill below) rather than shifted through one bit
+ * at a time, which is what earlier versions of this file did.
  */
 
 package deltagolomb
 
 import (
-	"io"
-	"bytes"
 	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math/bits"
 )
 
 type ExpGolombDecoder struct {
 	r byteReader
-	b byte
-	state int
-	val int
-	zeros int
-	nBits int
+
+	// acc holds up to 64 pending bits, MSB-aligned: the oldest
+	// unconsumed bit sits at position 63, the newest valid bit at
+	// position (64-nbits). Bits below that are always zero.
+	acc   uint64
+	nbits uint
+	err   error
+
+	state     int
+	val       int
+	zeros     uint
+	remaining uint
+	k         int
 }
 
 type ExpGolombEncoder struct {
-	data   byte
-	bitpos uint
-	out byteWriter
-}	
+	// acc mirrors the decoder's convention: pending output bits are
+	// MSB-aligned in the high nbits bits, with the rest always zero.
+	acc   uint64
+	nbits uint
+	out   byteWriter
+	k     int
+}
 
 // Create a new Exp-Golomb stream Encoder.
 // Accepts integers via the Write( []int ) method, and writes
@@ -46,18 +61,44 @@ type ExpGolombEncoder struct {
 // when finished to ensure that all bytes are written to w.
 func NewExpGolombEncoder(w io.Writer) *ExpGolombEncoder {
 	ww := makeWriter(w)
-	return &ExpGolombEncoder{0, 0, ww}
+	return &ExpGolombEncoder{0, 0, ww, 0}
 }
 
 // Create a new Exp-Golomb stream decoder.  Callers can read
 // decoded integers via the Read( []int ) method.  Reads bytes
 // from r as needed and as they become available.
-func NewExpGolombDecoder(r io.Reader) *ExpGolombDecoder{ 
+func NewExpGolombDecoder(r io.Reader) *ExpGolombDecoder{
 	d := &ExpGolombDecoder{}
 	d.r = makeReader(r)
 	return d
 }
 
+// Reset discards any buffered output and any partially-written
+// value, then retargets the encoder at w.  The order-k setting
+// carries over unchanged.  Reset lets a pool of encoders be reused
+// across streams without allocating a new ExpGolombEncoder each
+// time (see ExampleExpGolombEncoder_pool).
+func (s *ExpGolombEncoder) Reset(w io.Writer) {
+	s.acc = 0
+	s.nbits = 0
+	s.out = makeWriter(w)
+}
+
+// Reset discards any buffered input and any partially-read value,
+// then retargets the decoder at r.  The order-k setting carries
+// over unchanged.  Reset lets a pool of decoders be reused across
+// streams without allocating a new ExpGolombDecoder each time.
+func (s *ExpGolombDecoder) Reset(r io.Reader) {
+	s.r = makeReader(r)
+	s.acc = 0
+	s.nbits = 0
+	s.err = nil
+	s.state = COUNTING_ZEROS
+	s.val = 0
+	s.zeros = 0
+	s.remaining = 0
+}
+
 // Helper function stolen from compress/flate/inflate.go
 // If the passed in reader does not support ReadByte(), wrap
 // it in a bufio.
@@ -89,10 +130,12 @@ func makeWriter(w io.Writer) byteWriter {
 	return bufio.NewWriter(w)
 }
 
-// Decode states, bit-at-a-time (slow but safe)
+// Decode phases.
 const (
 	COUNTING_ZEROS = iota
 	SHIFTING_BITS
+	READING_LOW_BITS
+	READING_ESCAPE_BITS
 	READING_SIGN
 )
 
@@ -112,14 +155,60 @@ func (s *ExpGolombEncoder) WriteInt(i int) {
 }
 
 func (s *ExpGolombEncoder) Close() {
-	if (s.bitpos != 0) {
-		s.out.WriteByte(s.data)
+	s.flush()
+	if s.nbits != 0 {
+		s.out.WriteByte(byte(s.acc >> 56))
 	}
-	s.data = 0
-	s.bitpos = 0
+	s.acc = 0
+	s.nbits = 0
 	s.out.Flush()
 }
 
+// flush writes out every whole byte currently sitting in the top of
+// acc, in as few Write calls as possible, leaving fewer than 8 bits
+// pending.
+func (s *ExpGolombEncoder) flush() {
+	for s.nbits >= 8 {
+		nbytes := s.nbits / 8
+		var buf [8]byte
+		binary.BigEndian.PutUint64(buf[:], s.acc)
+		s.out.Write(buf[:nbytes])
+		s.acc <<= nbytes * 8
+		s.nbits -= nbytes * 8
+	}
+}
+
+// refill pulls more bytes from the underlying reader into acc,
+// stopping once there isn't room for another whole byte or the
+// reader runs dry.  Any read error is stashed in s.err and
+// re-returned by Read once the buffered bits are exhausted.
+func (s *ExpGolombDecoder) refill() {
+	for s.nbits <= 56 {
+		b, err := s.r.ReadByte()
+		if err != nil {
+			s.err = err
+			return
+		}
+		s.acc |= uint64(b) << (56 - s.nbits)
+		s.nbits += 8
+	}
+}
+
+// peek returns the top n pending bits without consuming them.
+// Requires n <= s.nbits.
+func (s *ExpGolombDecoder) peek(n uint) uint64 {
+	if n == 0 {
+		return 0
+	}
+	return s.acc >> (64 - n)
+}
+
+// consume discards the top n pending bits. Requires n <= s.nbits.
+func (s *ExpGolombDecoder) consume(n uint) {
+	s.acc <<= n
+	s.nbits -= n
+}
+
 // Decode a byte-stream of exp-golomb coded signed integers.
 // Reads all available bytes from 'in';
 // Emits decoded integers to 'out'.
@@ -127,56 +216,125 @@ func (s *ExpGolombDecoder) Read(out []int) (int, error) {
 	cpos := 0
 	n := len(out)
 
-	for {
-		if (s.nBits == 0) {
-			var readError error
-			s.b, readError = s.r.ReadByte()
-			if readError != nil {
-				return cpos, readError
-			} else {
-				s.nBits = 8
+	for cpos < n {
+		switch s.state {
+		case COUNTING_ZEROS:
+			s.refill()
+			if s.nbits == 0 {
+				return cpos, s.err
 			}
-		}
-		for s.nBits > 0 {
-			if cpos >= n {
-				return cpos, nil
+			lead := uint(bits.LeadingZeros64(s.acc))
+			if lead > s.nbits {
+				lead = s.nbits
 			}
-			bit := (s.b >> (uint(s.nBits - 1))) & 0x01
-			s.nBits--
+			if lead == s.nbits {
+				// No terminating 1 bit in the window we have;
+				// remember the run and wait for more input.
+				s.zeros += lead
+				s.acc = 0
+				s.nbits = 0
+				continue
+			}
+			s.zeros += lead
+			s.consume(lead + 1)
 
-			switch s.state {
-			case COUNTING_ZEROS:
-				if bit == 0 {
-					s.zeros++
+			if s.k == 0 {
+				if s.zeros == 0 {
+					out[cpos] = 0
+					cpos++
 				} else {
-					if s.zeros == 0 {
-						out[cpos] = 0
-						cpos++
-					} else {
-						s.state = SHIFTING_BITS
-						s.val = 1
-					}
+					s.val = 1
+					s.remaining = s.zeros
+					s.state = SHIFTING_BITS
 				}
-			case SHIFTING_BITS:
-				s.val <<= 1
-				s.val |= int(bit)
-				s.zeros--
-				if s.zeros == 0 {
-					s.val -= 1 // Because we stole bit for 0.
+			} else if s.zeros >= maxUnaryRun {
+				// addK caps the unary run it will ever emit at
+				// maxUnaryRun; this many zeros means the magnitude
+				// was encoded as a fixed-width escape instead of
+				// q/low bits (see addK).
+				s.val = 0
+				s.remaining = escapeBits
+				s.state = READING_ESCAPE_BITS
+			} else {
+				// Order-k decode: the terminating 1 is followed by
+				// k verbatim low bits that complete
+				// val = (zeros << k) | low.
+				s.val = int(s.zeros)
+				s.remaining = uint(s.k)
+				s.state = READING_LOW_BITS
+			}
+			s.zeros = 0
+
+		case SHIFTING_BITS:
+			s.refill()
+			if s.nbits == 0 {
+				return cpos, s.err
+			}
+			take := s.remaining
+			if take > s.nbits {
+				take = s.nbits
+			}
+			s.val = (s.val << take) | int(s.peek(take))
+			s.consume(take)
+			s.remaining -= take
+			if s.remaining == 0 {
+				s.val -= 1 // Because we stole a bit for 0.
+				s.state = READING_SIGN
+			}
+
+		case READING_LOW_BITS:
+			s.refill()
+			if s.nbits == 0 {
+				return cpos, s.err
+			}
+			take := s.remaining
+			if take > s.nbits {
+				take = s.nbits
+			}
+			s.val = (s.val << take) | int(s.peek(take))
+			s.consume(take)
+			s.remaining -= take
+			if s.remaining == 0 {
+				if s.val == 0 {
+					out[cpos] = 0
+					cpos++
+					s.state = COUNTING_ZEROS
+				} else {
 					s.state = READING_SIGN
 				}
-			case READING_SIGN:
-				if bit == 1 {
-					s.val = -s.val
-				}
-				out[cpos] = s.val
-				cpos++
-				s.state = COUNTING_ZEROS
 			}
+
+		case READING_ESCAPE_BITS:
+			s.refill()
+			if s.nbits == 0 {
+				return cpos, s.err
+			}
+			take := s.remaining
+			if take > s.nbits {
+				take = s.nbits
+			}
+			s.val = (s.val << take) | int(s.peek(take))
+			s.consume(take)
+			s.remaining -= take
+			if s.remaining == 0 {
+				s.state = READING_SIGN
+			}
+
+		case READING_SIGN:
+			s.refill()
+			if s.nbits == 0 {
+				return cpos, s.err
+			}
+			if s.peek(1) == 1 {
+				s.val = -s.val
+			}
+			s.consume(1)
+			out[cpos] = s.val
+			cpos++
+			s.state = COUNTING_ZEROS
 		}
 	}
-	// If we run off the end, do not emit the value.
-	return 0, nil // NOTREACHED
+	return cpos, nil
 }
 
 // Exponential golomb coding with an explicit sign bit for everything
@@ -199,6 +357,11 @@ func (s *ExpGolombDecoder) Read(out []int) (int, error) {
 // needed for larger values.
 
 func (s *ExpGolombEncoder) add(item int) {
+	if s.k > 0 {
+		s.addK(item)
+		return
+	}
+
 	// Quick optimization for the most common values we expect to encode.
 	// This has an obvious generalization to a small table if desired.
 	switch item {
@@ -228,51 +391,42 @@ func (s *ExpGolombEncoder) add(item int) {
 	return
 }
 
-// Helper function that adds nbits bit to the output byte stream.
-// Emits the byte(s) if they are full, otherwise just updates internal
-// state.
+// Helper function that adds nbits bits to the output byte stream,
+// buffering them in a 64-bit accumulator and flushing whole bytes
+// as they fill up.  nbits may be larger than the accumulator's
+// free space (e.g. a run of leading zeros plus a wide value), so
+// bits are dribbled in however many chunks the accumulator needs.
 func (s *ExpGolombEncoder) addBits(bits uint, nbits uint) {
-	bitsleft := uint(8) - s.bitpos
-	if nbits < bitsleft {
-		s.data |= (byte(bits) << (bitsleft - nbits))
-		s.bitpos += nbits
-		return
-	} else {
-		s.data |= byte(bits >> (nbits - bitsleft))
-		s.out.WriteByte(s.data)
-		s.bitpos = 0
-		s.data = 0
-		nbits -= bitsleft
-	}
-
-	for ; nbits > 8; nbits -= 8 {
-		s.data = byte((bits >> (nbits - 8)) & 0xff)
-		s.out.WriteByte(s.data)
+	for nbits > 0 {
+		take := 64 - s.nbits
+		if take > nbits {
+			take = nbits
+		}
+		shift := nbits - take
+		mask := uint64(1)<<take - 1
+		chunk := (uint64(bits) >> shift) & mask
+		s.acc |= chunk << (64 - s.nbits - take)
+		s.nbits += take
+		nbits -= take
+		s.flush()
 	}
-	s.data = byte((bits << (8 - nbits))  & 0xff)
-	s.bitpos = nbits
 }
 
-// Helper function specialized to add zeros to the output stream
+// Helper function specialized to add zeros to the output stream.
+// Since the bits beyond the current accumulator window are always
+// zero, this is just a matter of accounting for the extra pending
+// bits and flushing whole zero bytes as they fill up.  Chunked the
+// same way as addBits since nzeros can exceed the accumulator size.
 func (s *ExpGolombEncoder) addZeroBits(nzeros uint) {
-	// Split into three chunks:  Number of zeros we can add
-	// to the current byte;  number of intermediate zero bytes
-	// we should emit;  number of zeros to add to the new byte
-	// if any.
-	if nzeros < (8 - s.bitpos) {
-		s.bitpos += nzeros
-		return
-	} else {
-		nzeros -= (8 - s.bitpos)
-		s.out.WriteByte(s.data)
-		s.data = 0
-		s.bitpos = 0
-	}
-	// We now have a zero byte at bitpos 0.
-	for ; nzeros >= 8; nzeros -= 8 {
-		s.out.WriteByte(s.data)
+	for nzeros > 0 {
+		take := 64 - s.nbits
+		if take > nzeros {
+			take = nzeros
+		}
+		s.nbits += take
+		nzeros -= take
+		s.flush()
 	}
-	s.bitpos += nzeros
 }
 
 // Computes the number of bits needed to represent a value.
@@ -0,0 +1,343 @@
+/*
+ * Block-mode encoding: the integer stream is split into fixed-size
+ * blocks, each delta-coded independently against its own first
+ * value.  Because a block doesn't depend on any other block, a
+ * reader with random access to the underlying bytes can decode any
+ * single block without walking the whole stream -- turning point
+ * access from O(N) into O(N/blockSize + blockSize), and letting
+ * EncodeParallel code blocks on separate goroutines.
+ *
+ * Each block is laid out as:
+ *   varint  base        block[0], the value the block deltas against
+ *   varint  count       number of values in the block
+ *   varint  length      length in bytes of the coded payload
+ *   ...     payload     length bytes, an Exp-Golomb DeltaEncode(base, block) stream
+ *
+ * Blocks are simply concatenated, with no framing around the whole
+ * stream; wrap a BlockEncoder's output in a Frame (see
+ * deltagolomb_frame.go) if a magic/version/checksum is also wanted.
+ */
+
+package deltagolomb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"sync"
+)
+
+// BlockIndex records where one block lives in an encoded stream, so
+// a BlockDecoder can jump straight to the block containing a given
+// value index instead of decoding every block before it.
+type BlockIndex struct {
+	StartValue int
+	ByteOffset int64
+	Count      int
+}
+
+// BlockEncoder partitions the values it is given into fixed-size
+// blocks and writes each one, independently delta-coded, to the
+// wrapped io.Writer as soon as it fills -- unlike FrameWriter, it
+// does not need to buffer the whole stream in memory.
+type BlockEncoder struct {
+	w         io.Writer
+	blockSize int
+	pending   []int
+	err       error
+}
+
+// NewBlockEncoder returns a BlockEncoder that writes blockSize-value
+// blocks to w.  blockSize less than 1 is treated as 1.
+func NewBlockEncoder(w io.Writer, blockSize int) *BlockEncoder {
+	if blockSize < 1 {
+		blockSize = 1
+	}
+	return &BlockEncoder{w: w, blockSize: blockSize}
+}
+
+// Write appends vals to the pending block, flushing any blocks that
+// fill up as a result.
+func (e *BlockEncoder) Write(vals []int) {
+	e.pending = append(e.pending, vals...)
+	for len(e.pending) >= e.blockSize && e.err == nil {
+		e.writeBlock(e.pending[:e.blockSize])
+		e.pending = e.pending[e.blockSize:]
+	}
+}
+
+// Close flushes any remaining partial block and returns the first
+// write error encountered, if any.
+func (e *BlockEncoder) Close() error {
+	if len(e.pending) > 0 {
+		e.writeBlock(e.pending)
+		e.pending = nil
+	}
+	return e.err
+}
+
+func (e *BlockEncoder) writeBlock(block []int) {
+	if e.err != nil || len(block) == 0 {
+		return
+	}
+	if _, err := e.w.Write(encodeBlock(block)); err != nil {
+		e.err = err
+	}
+}
+
+// encodeBlock codes a single block -- base, count, length, payload
+// -- as described in the package comment above.
+func encodeBlock(block []int) []byte {
+	base := block[0]
+	payload := DeltaEncode(base, block)
+
+	var out bytes.Buffer
+	var vbuf [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(vbuf[:], int64(base))
+	out.Write(vbuf[:n])
+	n = binary.PutUvarint(vbuf[:], uint64(len(block)))
+	out.Write(vbuf[:n])
+	n = binary.PutUvarint(vbuf[:], uint64(len(payload)))
+	out.Write(vbuf[:n])
+	out.Write(payload)
+	return out.Bytes()
+}
+
+// EncodeParallel block-encodes vals exactly as NewBlockEncoder would,
+// but codes the blocks across workers goroutines before
+// concatenating them in order, for throughput on long sequences.
+// One difference: blockSize less than 1 codes all of vals as a single
+// block, where NewBlockEncoder would use blocks of 1.
+func EncodeParallel(vals []int, blockSize int, workers int) []byte {
+	if blockSize <= 0 {
+		blockSize = len(vals)
+	}
+	if blockSize == 0 {
+		return nil
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	numBlocks := (len(vals) + blockSize - 1) / blockSize
+	coded := make([][]byte, numBlocks)
+
+	type job struct {
+		idx   int
+		block []int
+	}
+	jobs := make(chan job)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				coded[j.idx] = encodeBlock(j.block)
+			}
+		}()
+	}
+
+	for i := 0; i < numBlocks; i++ {
+		start := i * blockSize
+		end := start + blockSize
+		if end > len(vals) {
+			end = len(vals)
+		}
+		jobs <- job{idx: i, block: vals[start:end]}
+	}
+	close(jobs)
+	wg.Wait()
+
+	var out bytes.Buffer
+	for _, b := range coded {
+		out.Write(b)
+	}
+	return out.Bytes()
+}
+
+// BlockDecoder reads a stream written by BlockEncoder or
+// EncodeParallel.  r must be an io.ReadSeeker: Read only reads from
+// it sequentially, while Seek and Index also seek it so the decoder
+// can jump to an arbitrary block's byte offset.
+type BlockDecoder struct {
+	r io.ReadSeeker
+
+	index []BlockIndex
+
+	cur    []int
+	curIdx int
+}
+
+// NewBlockDecoder returns a BlockDecoder reading from r.
+func NewBlockDecoder(r io.ReadSeeker) *BlockDecoder {
+	return &BlockDecoder{r: r}
+}
+
+// Read decodes values sequentially from the current position,
+// crossing block boundaries transparently.
+func (d *BlockDecoder) Read(out []int) (int, error) {
+	cpos := 0
+	for cpos < len(out) {
+		if d.curIdx >= len(d.cur) {
+			vals, err := d.readBlock()
+			if err != nil {
+				return cpos, err
+			}
+			d.cur = vals
+			d.curIdx = 0
+			if len(vals) == 0 {
+				continue
+			}
+		}
+		n := copy(out[cpos:], d.cur[d.curIdx:])
+		d.curIdx += n
+		cpos += n
+	}
+	return cpos, nil
+}
+
+// Seek positions the decoder so the next Read returns the value at
+// valueIndex first.  It builds (and caches) a BlockIndex over the
+// whole stream on first use, then seeks r directly to the
+// containing block rather than decoding every block before it.
+func (d *BlockDecoder) Seek(valueIndex int) error {
+	if valueIndex < 0 {
+		return io.EOF
+	}
+	if err := d.ensureIndex(); err != nil {
+		return err
+	}
+
+	global := 0
+	for _, bi := range d.index {
+		if valueIndex < global+bi.Count {
+			if _, err := d.r.Seek(bi.ByteOffset, io.SeekStart); err != nil {
+				return err
+			}
+			vals, err := d.readBlock()
+			if err != nil {
+				return err
+			}
+			d.cur = vals
+			d.curIdx = valueIndex - global
+			return nil
+		}
+		global += bi.Count
+	}
+	return io.EOF
+}
+
+// Index returns the BlockIndex built so far, building it if
+// necessary.  Exposed so callers can inspect block boundaries
+// directly (e.g. to plan parallel decode of their own).
+func (d *BlockDecoder) Index() ([]BlockIndex, error) {
+	if err := d.ensureIndex(); err != nil {
+		return nil, err
+	}
+	return d.index, nil
+}
+
+// ensureIndex scans the whole stream once, recording each block's
+// header without decoding its payload, then restores the reader to
+// wherever it was before the scan.
+func (d *BlockDecoder) ensureIndex() error {
+	if d.index != nil {
+		return nil
+	}
+
+	saved, err := d.r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := d.r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	var index []BlockIndex
+	var offset int64
+	for {
+		cbr := &offsetByteReader{r: d.r}
+		base, err := binary.ReadVarint(cbr)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		count, err := binary.ReadUvarint(cbr)
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		length, err := binary.ReadUvarint(cbr)
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		if length > maxCodedLength {
+			return io.ErrUnexpectedEOF
+		}
+
+		index = append(index, BlockIndex{
+			StartValue: int(base),
+			ByteOffset: offset,
+			Count:      int(count),
+		})
+
+		offset += cbr.n + int64(length)
+		if _, err := d.r.Seek(int64(length), io.SeekCurrent); err != nil {
+			return unexpectedEOF(err)
+		}
+	}
+
+	d.index = index
+	_, err = d.r.Seek(saved, io.SeekStart)
+	return err
+}
+
+// readBlock reads and decodes a single block starting at the
+// reader's current position, leaving the reader positioned at the
+// start of the next block.
+func (d *BlockDecoder) readBlock() ([]int, error) {
+	cbr := &offsetByteReader{r: d.r}
+	base, err := binary.ReadVarint(cbr)
+	if err != nil {
+		return nil, err
+	}
+	count, err := binary.ReadUvarint(cbr)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	length, err := binary.ReadUvarint(cbr)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	payload, err := readPayload(d.r, length)
+	if err != nil {
+		return nil, err
+	}
+
+	vals := DeltaDecode(int(base), payload)
+	if uint64(len(vals)) != count {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return vals, nil
+}
+
+// offsetByteReader adapts an io.Reader to io.ByteReader one byte at
+// a time, counting the bytes consumed so callers can compute byte
+// offsets around a run of binary.ReadVarint/ReadUvarint calls.
+type offsetByteReader struct {
+	r io.Reader
+	n int64
+}
+
+func (o *offsetByteReader) ReadByte() (byte, error) {
+	var b [1]byte
+	if _, err := io.ReadFull(o.r, b[:]); err != nil {
+		return 0, err
+	}
+	o.n++
+	return b[0], nil
+}
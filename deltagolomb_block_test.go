@@ -0,0 +1,185 @@
+package deltagolomb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+func TestBlockEncodeDecodeSequential(t *testing.T) {
+	base := 77003
+	vals := make([]int, 517) // deliberately not a multiple of the block size
+	for i := range vals {
+		vals[i] = base + (i%19)*(i%19) - i%3
+	}
+
+	buf := &bytes.Buffer{}
+	enc := NewBlockEncoder(buf, 64)
+	enc.Write(vals)
+	if err := enc.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	dec := NewBlockDecoder(bytes.NewReader(buf.Bytes()))
+	got := make([]int, len(vals))
+	n, err := dec.Read(got)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if n != len(vals) {
+		t.Fatalf("got %d values, want %d", n, len(vals))
+	}
+	for i, v := range vals {
+		if got[i] != v {
+			t.Fatalf("item %d was %d, want %d", i, got[i], v)
+		}
+	}
+}
+
+func TestBlockDecoderSeek(t *testing.T) {
+	vals := make([]int, 300)
+	for i := range vals {
+		vals[i] = i * 3
+	}
+
+	buf := &bytes.Buffer{}
+	enc := NewBlockEncoder(buf, 32)
+	enc.Write(vals)
+	if err := enc.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	dec := NewBlockDecoder(bytes.NewReader(buf.Bytes()))
+	for _, idx := range []int{0, 1, 31, 32, 33, 127, 299} {
+		if err := dec.Seek(idx); err != nil {
+			t.Fatalf("Seek(%d): %v", idx, err)
+		}
+		got := make([]int, 1)
+		n, err := dec.Read(got)
+		if err != nil {
+			t.Fatalf("Seek(%d): Read: %v", idx, err)
+		}
+		if n != 1 {
+			t.Fatalf("Seek(%d): Read returned %d values, want 1", idx, n)
+		}
+		if got[0] != vals[idx] {
+			t.Fatalf("Seek(%d) got %d, want %d", idx, got[0], vals[idx])
+		}
+	}
+
+	if err := dec.Seek(-1); err != io.EOF {
+		t.Fatalf("Seek(-1) = %v, want io.EOF", err)
+	}
+	if err := dec.Seek(len(vals) + 1); err != io.EOF {
+		t.Fatalf("Seek(%d) = %v, want io.EOF", len(vals)+1, err)
+	}
+}
+
+func TestNewBlockEncoderClampsBlockSize(t *testing.T) {
+	for _, size := range []int{0, -1, -100} {
+		buf := &bytes.Buffer{}
+		enc := NewBlockEncoder(buf, size)
+		enc.Write([]int{1, 2, 3})
+		if err := enc.Close(); err != nil {
+			t.Fatalf("blockSize %d: Close: %v", size, err)
+		}
+
+		dec := NewBlockDecoder(bytes.NewReader(buf.Bytes()))
+		got := make([]int, 3)
+		n, err := dec.Read(got)
+		if err != nil {
+			t.Fatalf("blockSize %d: Read: %v", size, err)
+		}
+		if n != 3 || got[0] != 1 || got[1] != 2 || got[2] != 3 {
+			t.Fatalf("blockSize %d: got %v, want [1 2 3]", size, got[:n])
+		}
+	}
+}
+
+func TestBlockDecoderHugeLengthDoesNotPanic(t *testing.T) {
+	var buf bytes.Buffer
+	var v [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(v[:], 0) // base
+	buf.Write(v[:n])
+	n = binary.PutUvarint(v[:], 5) // count
+	buf.Write(v[:n])
+	n = binary.PutUvarint(v[:], 1<<62) // a corrupted, implausible length
+	buf.Write(v[:n])
+
+	dec := NewBlockDecoder(bytes.NewReader(buf.Bytes()))
+	got := make([]int, 5)
+	if _, err := dec.Read(got); err != io.ErrUnexpectedEOF {
+		t.Fatalf("Read: got err %v, want io.ErrUnexpectedEOF", err)
+	}
+
+	dec2 := NewBlockDecoder(bytes.NewReader(buf.Bytes()))
+	if _, err := dec2.Index(); err != io.ErrUnexpectedEOF {
+		t.Fatalf("Index: got err %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestBlockDecoderIndex(t *testing.T) {
+	vals := make([]int, 100)
+	for i := range vals {
+		vals[i] = i
+	}
+
+	buf := &bytes.Buffer{}
+	enc := NewBlockEncoder(buf, 25)
+	enc.Write(vals)
+	if err := enc.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	dec := NewBlockDecoder(bytes.NewReader(buf.Bytes()))
+	index, err := dec.Index()
+	if err != nil {
+		t.Fatalf("Index: %v", err)
+	}
+	if len(index) != 4 {
+		t.Fatalf("got %d blocks, want 4", len(index))
+	}
+	for i, bi := range index {
+		if bi.Count != 25 {
+			t.Fatalf("block %d: count = %d, want 25", i, bi.Count)
+		}
+		if bi.StartValue != vals[i*25] {
+			t.Fatalf("block %d: startValue = %d, want %d", i, bi.StartValue, vals[i*25])
+		}
+	}
+}
+
+func TestEncodeParallelMatchesSequential(t *testing.T) {
+	vals := make([]int, 1000)
+	for i := range vals {
+		vals[i] = i*i%97 - 50
+	}
+
+	buf := &bytes.Buffer{}
+	enc := NewBlockEncoder(buf, 50)
+	enc.Write(vals)
+	if err := enc.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	parallel := EncodeParallel(vals, 50, 4)
+	if !bytes.Equal(buf.Bytes(), parallel) {
+		t.Fatalf("EncodeParallel output differs from sequential BlockEncoder output")
+	}
+
+	dec := NewBlockDecoder(bytes.NewReader(parallel))
+	got := make([]int, len(vals))
+	n, err := dec.Read(got)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if n != len(vals) {
+		t.Fatalf("got %d values, want %d", n, len(vals))
+	}
+	for i, v := range vals {
+		if got[i] != v {
+			t.Fatalf("item %d was %d, want %d", i, got[i], v)
+		}
+	}
+}
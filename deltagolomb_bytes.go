@@ -0,0 +1,78 @@
+/*
+ * Byte-oriented io.Writer/io.Reader adapters around ExpGolombEncoder
+ * and ExpGolombDecoder, for composing deltagolomb into ordinary
+ * io.Copy/compress-style pipelines where the caller only has raw
+ * bytes rather than a pre-built []int.  Each byte is treated as a
+ * signed int8, which is already in the small-magnitude range
+ * Exp-Golomb codes most compactly.
+ */
+
+package deltagolomb
+
+import "io"
+
+// ByteEncoder adapts an ExpGolombEncoder to io.Writer, coding each
+// input byte as a signed int8.
+type ByteEncoder struct {
+	enc *ExpGolombEncoder
+}
+
+// NewByteEncoder returns a ByteEncoder writing Exp-Golomb coded
+// output to w.  Callers must call Close to flush buffered bits.
+func NewByteEncoder(w io.Writer) *ByteEncoder {
+	return &ByteEncoder{enc: NewExpGolombEncoder(w)}
+}
+
+func (b *ByteEncoder) Write(p []byte) (int, error) {
+	for _, c := range p {
+		b.enc.WriteInt(int(int8(c)))
+	}
+	return len(p), nil
+}
+
+// Close flushes any buffered bits to the underlying writer.
+func (b *ByteEncoder) Close() error {
+	b.enc.Close()
+	return nil
+}
+
+// Reset retargets the ByteEncoder at w, discarding any buffered
+// output, for reuse from a sync.Pool.
+func (b *ByteEncoder) Reset(w io.Writer) {
+	b.enc.Reset(w)
+}
+
+// ByteDecoder adapts an ExpGolombDecoder to io.Reader, recovering
+// the bytes written by a ByteEncoder.
+type ByteDecoder struct {
+	dec *ExpGolombDecoder
+	buf []int
+}
+
+// NewByteDecoder returns a ByteDecoder reading Exp-Golomb coded
+// bytes from r.
+func NewByteDecoder(r io.Reader) *ByteDecoder {
+	return &ByteDecoder{dec: NewExpGolombDecoder(r)}
+}
+
+func (b *ByteDecoder) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if cap(b.buf) < len(p) {
+		b.buf = make([]int, len(p))
+	}
+	ints := b.buf[:len(p)]
+
+	n, err := b.dec.Read(ints)
+	for i := 0; i < n; i++ {
+		p[i] = byte(int8(ints[i]))
+	}
+	return n, err
+}
+
+// Reset retargets the ByteDecoder at r, discarding any buffered
+// input, for reuse from a sync.Pool.
+func (b *ByteDecoder) Reset(r io.Reader) {
+	b.dec.Reset(r)
+}
@@ -0,0 +1,54 @@
+package deltagolomb
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func TestByteEncoderDecoder(t *testing.T) {
+	orig := []byte("the quick brown fox jumps over the lazy dog, 1234567890!")
+
+	buf := &bytes.Buffer{}
+	enc := NewByteEncoder(buf)
+	enc.Write(orig)
+	if err := enc.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	dec := NewByteDecoder(buf)
+	got := make([]byte, len(orig))
+	n, err := dec.Read(got)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if n != len(orig) {
+		t.Fatalf("got %d bytes, want %d", n, len(orig))
+	}
+	if !bytes.Equal(got, orig) {
+		t.Fatalf("got %q, want %q", got, orig)
+	}
+}
+
+// ExampleExpGolombEncoder_pool shows the intended sync.Pool usage:
+// each Reset retargets a reused encoder at a fresh destination
+// instead of allocating a new one.
+func ExampleExpGolombEncoder_pool() {
+	pool := sync.Pool{
+		New: func() interface{} { return NewExpGolombEncoder(nil) },
+	}
+
+	encodeOne := func(w *bytes.Buffer, vals []int) {
+		enc := pool.Get().(*ExpGolombEncoder)
+		enc.Reset(w)
+		enc.Write(vals)
+		enc.Close()
+		pool.Put(enc)
+	}
+
+	var a, b bytes.Buffer
+	encodeOne(&a, []int{0, 1, -1})
+	encodeOne(&b, []int{2, -2, 3})
+
+	// Output:
+}
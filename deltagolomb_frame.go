@@ -0,0 +1,275 @@
+/*
+ * A self-describing frame format around the Exp-Golomb/FSE payloads
+ * above, similar in spirit to the flate/zstd frame headers: a magic
+ * number and version so a reader can recognize and reject streams
+ * it doesn't understand, a flags byte recording how the payload was
+ * coded, and an optional trailer so corruption is caught end-to-end
+ * instead of silently producing garbage integers.
+ *
+ * Layout:
+ *   4 bytes  magic    "DGB1"
+ *   1 byte   version  frameVersion
+ *   1 byte   flags    see flag* constants below
+ *   varint   base     the delta-decode starting value (signed)
+ *   varint   count    number of encoded integers
+ *   varint   length   length in bytes of the coded payload
+ *   ...      payload  length bytes, coded per flags
+ *   4 bytes  checksum CRC32-IEEE of the decoded integers, if flagChecksum is set
+ */
+
+package deltagolomb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+var frameMagic = [4]byte{'D', 'G', 'B', '1'}
+
+const frameVersion = 1
+
+// EntropyCoder selects which residual coder a Frame uses for its
+// payload.
+type EntropyCoder byte
+
+const (
+	EntropyExpGolomb EntropyCoder = iota
+	EntropyFSE
+)
+
+// Flag bits within the frame's one-byte flags field.  The low 5
+// bits hold the Exp-Golomb order-k value (0-31, ignored when the
+// entropy coder is EntropyFSE); the remaining bits are single-bit
+// switches.
+const (
+	flagKMask      = 0x1f
+	flagEntropyFSE = 1 << 5
+	flagChecksum   = 1 << 6
+)
+
+// ErrChecksum is returned by FrameReader.Read when a frame carries a
+// checksum trailer that does not match its decoded integers.
+var ErrChecksum = errors.New("deltagolomb: frame checksum mismatch")
+
+// ErrBadMagic is returned by FrameReader.Read when the stream does
+// not begin with the deltagolomb frame magic.
+var ErrBadMagic = errors.New("deltagolomb: bad frame magic")
+
+// ErrUnsupportedVersion is returned by FrameReader.Read for frames
+// written by a newer, incompatible version of this package.
+var ErrUnsupportedVersion = errors.New("deltagolomb: unsupported frame version")
+
+// ErrInvalidK is returned by FrameWriter.Close when opts.K falls
+// outside [0, 31], the range the one-byte flags field can represent
+// without truncation; K is not checked when opts.Entropy is
+// EntropyFSE, which ignores it. Writing the frame anyway would record a flags
+// byte that disagrees with the k the payload was actually coded
+// with, so FrameReader.Read would silently decode garbage.
+var ErrInvalidK = errors.New("deltagolomb: frame K must be in [0, 31]")
+
+// maxCodedLength bounds the varint-prefixed payload lengths trusted
+// by readPayload, so a corrupted or malicious length prefix (e.g.
+// claiming 1<<62 bytes) fails cleanly instead of panicking in
+// make([]byte, length) before a single byte has even been read.
+const maxCodedLength = 1 << 32
+
+// readPayload reads exactly length bytes from r, the shared helper
+// behind every length-prefixed payload in this package (frames and
+// blocks alike). An implausible length is rejected before
+// allocating; a short read is reported as io.ErrUnexpectedEOF.
+func readPayload(r io.Reader, length uint64) ([]byte, error) {
+	if length > maxCodedLength {
+		return nil, io.ErrUnexpectedEOF
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return payload, nil
+}
+
+// FrameOptions controls how a FrameWriter codes its payload.
+type FrameOptions struct {
+	K        int // Exp-Golomb order; ignored when Entropy is EntropyFSE.
+	Entropy  EntropyCoder
+	Checksum bool // append a CRC32 trailer over the decoded integers
+}
+
+// FrameWriter accumulates integers written via Write and, on Close,
+// delta- and entropy-codes them and writes a single self-describing
+// frame to the wrapped io.Writer.  Unlike ExpGolombEncoder, a
+// FrameWriter is not incremental: nothing reaches w until Close,
+// since the frame header carries the final element count and byte
+// length.
+type FrameWriter struct {
+	w     io.Writer
+	start int
+	opts  FrameOptions
+	vals  []int
+}
+
+// NewFrameWriter creates a FrameWriter that will delta-encode the
+// values it is given relative to start, coded per opts, and write
+// the resulting frame to w when Close is called.
+func NewFrameWriter(w io.Writer, start int, opts FrameOptions) *FrameWriter {
+	return &FrameWriter{w: w, start: start, opts: opts}
+}
+
+// Write appends vals to the set of integers the frame will encode.
+func (f *FrameWriter) Write(vals []int) {
+	f.vals = append(f.vals, vals...)
+}
+
+// Close codes every value supplied via Write and writes the
+// complete frame to the underlying io.Writer.  It must be called
+// exactly once.
+func (f *FrameWriter) Close() error {
+	if f.opts.Entropy != EntropyFSE && (f.opts.K < 0 || f.opts.K > flagKMask) {
+		return ErrInvalidK
+	}
+
+	var payload []byte
+	switch f.opts.Entropy {
+	case EntropyFSE:
+		payload = DeltaEncodeFSE(f.start, f.vals)
+	default:
+		if f.opts.K > 0 {
+			payload = DeltaEncodeK(f.start, f.opts.K, f.vals)
+		} else {
+			payload = DeltaEncode(f.start, f.vals)
+		}
+	}
+
+	flags := byte(f.opts.K) & flagKMask
+	if f.opts.Entropy == EntropyFSE {
+		flags |= flagEntropyFSE
+	}
+	if f.opts.Checksum {
+		flags |= flagChecksum
+	}
+
+	var hdr bytes.Buffer
+	hdr.Write(frameMagic[:])
+	hdr.WriteByte(frameVersion)
+	hdr.WriteByte(flags)
+
+	var varintBuf [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(varintBuf[:], int64(f.start))
+	hdr.Write(varintBuf[:n])
+	n = binary.PutUvarint(varintBuf[:], uint64(len(f.vals)))
+	hdr.Write(varintBuf[:n])
+	n = binary.PutUvarint(varintBuf[:], uint64(len(payload)))
+	hdr.Write(varintBuf[:n])
+
+	if _, err := f.w.Write(hdr.Bytes()); err != nil {
+		return err
+	}
+	if _, err := f.w.Write(payload); err != nil {
+		return err
+	}
+	if f.opts.Checksum {
+		var cbuf [4]byte
+		binary.BigEndian.PutUint32(cbuf[:], checksumInts(f.vals))
+		if _, err := f.w.Write(cbuf[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checksumInts returns the CRC32-IEEE checksum of vals, each
+// serialized as a big-endian 8-byte word.
+func checksumInts(vals []int) uint32 {
+	var buf [8]byte
+	h := crc32.NewIEEE()
+	for _, v := range vals {
+		binary.BigEndian.PutUint64(buf[:], uint64(v))
+		h.Write(buf[:])
+	}
+	return h.Sum32()
+}
+
+// FrameReader decodes a single frame written by FrameWriter.
+type FrameReader struct {
+	r io.Reader
+}
+
+// NewFrameReader creates a FrameReader that reads a frame from r.
+func NewFrameReader(r io.Reader) *FrameReader {
+	return &FrameReader{r: r}
+}
+
+// Read decodes the entire frame and returns the reconstructed
+// integers.  It returns io.ErrUnexpectedEOF if the stream is
+// truncated, ErrBadMagic or ErrUnsupportedVersion if the header is
+// not recognized, and ErrChecksum if a present checksum trailer
+// does not match the decoded values.
+func (f *FrameReader) Read() ([]int, error) {
+	br := makeReader(f.r)
+
+	var hdr [6]byte
+	if _, err := io.ReadFull(br, hdr[:]); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(hdr[:4], frameMagic[:]) {
+		return nil, ErrBadMagic
+	}
+	if hdr[4] != frameVersion {
+		return nil, ErrUnsupportedVersion
+	}
+	flags := hdr[5]
+
+	start, err := binary.ReadVarint(br)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	count, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	length, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	payload, err := readPayload(br, length)
+	if err != nil {
+		return nil, err
+	}
+
+	var vals []int
+	if flags&flagEntropyFSE != 0 {
+		vals = DeltaDecodeFSE(int(start), payload)
+	} else {
+		vals = DeltaDecodeK(int(start), int(flags&flagKMask), payload)
+	}
+	if uint64(len(vals)) != count {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	if flags&flagChecksum != 0 {
+		var cbuf [4]byte
+		if _, err := io.ReadFull(br, cbuf[:]); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if binary.BigEndian.Uint32(cbuf[:]) != checksumInts(vals) {
+			return nil, ErrChecksum
+		}
+	}
+
+	return vals, nil
+}
+
+// unexpectedEOF turns a clean io.EOF encountered mid-frame (where
+// more data is always expected next) into io.ErrUnexpectedEOF, the
+// signal that the stream was truncated rather than exhausted on a
+// natural boundary.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
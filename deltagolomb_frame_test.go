@@ -0,0 +1,116 @@
+package deltagolomb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+func TestFrameWriterReader(t *testing.T) {
+	base := 41207
+	vals := make([]int, 200)
+	for i := range vals {
+		vals[i] = base + (i%29)*(i%29) - i%11
+	}
+
+	cases := []FrameOptions{
+		{K: 0, Entropy: EntropyExpGolomb, Checksum: false},
+		{K: 4, Entropy: EntropyExpGolomb, Checksum: true},
+		{K: 0, Entropy: EntropyFSE, Checksum: true},
+	}
+
+	for _, opts := range cases {
+		buf := &bytes.Buffer{}
+		fw := NewFrameWriter(buf, base, opts)
+		fw.Write(vals)
+		if err := fw.Close(); err != nil {
+			t.Fatalf("%+v: Close: %v", opts, err)
+		}
+
+		fr := NewFrameReader(buf)
+		got, err := fr.Read()
+		if err != nil {
+			t.Fatalf("%+v: Read: %v", opts, err)
+		}
+		if len(got) != len(vals) {
+			t.Fatalf("%+v: got %d values, want %d", opts, len(got), len(vals))
+		}
+		for i, v := range vals {
+			if got[i] != v {
+				t.Fatalf("%+v: item %d was %d, want %d", opts, i, got[i], v)
+			}
+		}
+	}
+}
+
+func TestFrameReaderBadMagic(t *testing.T) {
+	fr := NewFrameReader(bytes.NewBufferString("not a frame at all"))
+	if _, err := fr.Read(); err != ErrBadMagic {
+		t.Fatalf("got err %v, want ErrBadMagic", err)
+	}
+}
+
+func TestFrameReaderTruncated(t *testing.T) {
+	buf := &bytes.Buffer{}
+	fw := NewFrameWriter(buf, 0, FrameOptions{Checksum: true})
+	fw.Write([]int{1, 2, 3, 4, 5})
+	if err := fw.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	full := buf.Bytes()
+	truncated := bytes.NewBuffer(full[:len(full)-2])
+	fr := NewFrameReader(truncated)
+	if _, err := fr.Read(); err != io.ErrUnexpectedEOF {
+		t.Fatalf("got err %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestFrameReaderHugeLengthDoesNotPanic(t *testing.T) {
+	var buf bytes.Buffer
+	buf.Write(frameMagic[:])
+	buf.WriteByte(frameVersion)
+	buf.WriteByte(0) // flags
+
+	var v [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(v[:], 0) // base
+	buf.Write(v[:n])
+	n = binary.PutUvarint(v[:], 5) // count
+	buf.Write(v[:n])
+	n = binary.PutUvarint(v[:], 1<<62) // a corrupted, implausible length
+	buf.Write(v[:n])
+
+	fr := NewFrameReader(bytes.NewReader(buf.Bytes()))
+	if _, err := fr.Read(); err != io.ErrUnexpectedEOF {
+		t.Fatalf("got err %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestFrameWriterInvalidK(t *testing.T) {
+	for _, k := range []int{-1, 32, 1000} {
+		buf := &bytes.Buffer{}
+		fw := NewFrameWriter(buf, 0, FrameOptions{K: k})
+		fw.Write([]int{1, 2, 3})
+		if err := fw.Close(); err != ErrInvalidK {
+			t.Fatalf("K=%d: Close = %v, want ErrInvalidK", k, err)
+		}
+	}
+}
+
+func TestFrameReaderChecksumMismatch(t *testing.T) {
+	buf := &bytes.Buffer{}
+	fw := NewFrameWriter(buf, 0, FrameOptions{Checksum: true})
+	fw.Write([]int{1, 2, 3, 4, 5})
+	if err := fw.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	corrupted := buf.Bytes()
+	corrupted[len(corrupted)-1] ^= 0xff
+
+	fr := NewFrameReader(bytes.NewBuffer(corrupted))
+	if _, err := fr.Read(); err != ErrChecksum {
+		t.Fatalf("got err %v, want ErrChecksum", err)
+	}
+}
@@ -0,0 +1,43 @@
+package deltagolomb
+
+import "testing"
+
+func TestDeltaEncodeDecodeFSE(t *testing.T) {
+	o := make([]int, 200)
+	base := 914
+	for i := range o {
+		o[i] = base + (i%13)*(i%13) - i%7
+	}
+
+	e := DeltaEncodeFSE(base, o)
+	d := DeltaDecodeFSE(base, e)
+	if len(d) != len(o) {
+		t.Fatalf("len(d) = %d, want %d", len(d), len(o))
+	}
+	for i := range o {
+		if d[i] != o[i] {
+			t.Fatalf("item %d mismatch, want %d got %d", i, o[i], d[i])
+		}
+	}
+}
+
+// TestDeltaEncodeDecodeFSEWideValues exercises residuals whose
+// magnitude exceeds 2^31, matching chunk0-3's TestEncodeDecodeWideValues
+// for the Exp-Golomb path: a caller picking an entropy backend via
+// FrameOptions.Entropy shouldn't see one silently corrupt values the
+// other codes correctly.
+func TestDeltaEncodeDecodeFSEWideValues(t *testing.T) {
+	base := 0
+	o := []int{1 << 40, 2 << 40, -(1 << 40) + 5}
+
+	e := DeltaEncodeFSE(base, o)
+	d := DeltaDecodeFSE(base, e)
+	if len(d) != len(o) {
+		t.Fatalf("len(d) = %d, want %d", len(d), len(o))
+	}
+	for i := range o {
+		if d[i] != o[i] {
+			t.Fatalf("item %d mismatch, want %d got %d", i, o[i], d[i])
+		}
+	}
+}
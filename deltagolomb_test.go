@@ -3,6 +3,7 @@ package deltagolomb
 import (
 	"bytes"
 	"io/ioutil"
+	"math"
 	"math/rand"
 	"testing"
 )
@@ -112,6 +113,36 @@ func TestDeltaEncodeDecode(t *testing.T) {
 	}
 }
 
+// TestEncodeDecodeWideValues exercises values wide enough that a
+// single add() call needs more bits than fit in one pass through the
+// accumulator (the zero run plus magnitude for a near-MaxInt64 value
+// is well over 64 bits), so addBits/addZeroBits must dribble them in
+// across several flushes rather than overflowing the 64-bit register.
+func TestEncodeDecodeWideValues(t *testing.T) {
+	vals := []int{
+		math.MaxInt32, -math.MaxInt32,
+		math.MaxInt64 / 2, -(math.MaxInt64 / 2),
+		1<<62 - 1, -(1<<62 - 1),
+	}
+
+	buf := &bytes.Buffer{}
+	encoder := NewExpGolombEncoder(buf)
+	encoder.Write(vals)
+	encoder.Close()
+
+	decoder := NewExpGolombDecoder(buf)
+	res := make([]int, len(vals))
+	n, _ := decoder.Read(res)
+	if n != len(vals) {
+		t.Fatalf("Not enough results.  Expected %d, got %d\n", len(vals), n)
+	}
+	for i, exp := range vals {
+		if res[i] != exp {
+			t.Fatalf("item %d was %d, expected %d\n", i, res[i], exp)
+		}
+	}
+}
+
 var benchvals = []int{0, 1, -1, 2, -5}
 
 func BenchmarkExpGEncode(b *testing.B) {
@@ -128,7 +159,9 @@ func BenchmarkExpGEncode(b *testing.B) {
 // Benchmarks decode speed.  Because it resets the buffer
 // and does some other work, this test decodes 200 symbols
 // per iteration, so divde the ns/op by 200 to find
-// the per-symbol cost.
+// the per-symbol cost.  The decoder is reused across iterations via
+// Reset rather than reallocated, matching how a pooled decoder would
+// be driven in practice.
 func BenchmarkExpGDecode(b *testing.B) {
 	b.StopTimer()
 	buf := &bytes.Buffer{}
@@ -142,10 +175,11 @@ func BenchmarkExpGDecode(b *testing.B) {
 	saved_b := make([]byte, len(bbytes))
 	copy(saved_b, bbytes)
 
+	decoder := NewExpGolombDecoder(buf)
 	b.StartTimer()
 	res := make([]int, 200)
 	for i := 0; i < b.N; i++ {
-		decoder := NewExpGolombDecoder(buf)
+		decoder.Reset(buf)
 		n, _ := decoder.Read(res)
 		if n != 200 {
 			b.Fatalf("Expected 200 ints, got %d", n)
@@ -154,3 +188,53 @@ func BenchmarkExpGDecode(b *testing.B) {
 		buf.Write(saved_b)
 	}
 }
+
+// benchrandvals holds wide, unpredictable magnitudes, as opposed to
+// benchvals' small fixed table entries, so these benchmarks show the
+// accumulator's win on the multi-bit zero-run/magnitude path rather
+// than the single-byte addBits fast cases.
+var benchrandvals = func() []int {
+	vals := make([]int, 200)
+	for i := range vals {
+		vals[i] = rand.Int()
+	}
+	return vals
+}()
+
+func BenchmarkExpGEncodeWide(b *testing.B) {
+	b.StopTimer()
+
+	egs := NewExpGolombEncoder(ioutil.Discard)
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		egs.Write(benchrandvals)
+	}
+	egs.Close()
+}
+
+// Benchmarks decode speed on wide values; see BenchmarkExpGDecode
+// for the division-by-symbol-count note.
+func BenchmarkExpGDecodeWide(b *testing.B) {
+	b.StopTimer()
+	buf := &bytes.Buffer{}
+	egs := NewExpGolombEncoder(buf)
+	egs.Write(benchrandvals)
+	egs.Close()
+
+	bbytes := buf.Bytes()
+	saved_b := make([]byte, len(bbytes))
+	copy(saved_b, bbytes)
+
+	decoder := NewExpGolombDecoder(buf)
+	b.StartTimer()
+	res := make([]int, len(benchrandvals))
+	for i := 0; i < b.N; i++ {
+		decoder.Reset(buf)
+		n, _ := decoder.Read(res)
+		if n != len(benchrandvals) {
+			b.Fatalf("Expected %d ints, got %d", len(benchrandvals), n)
+		}
+		buf.Reset()
+		buf.Write(saved_b)
+	}
+}
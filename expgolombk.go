@@ -0,0 +1,216 @@
+/*
+ * Order-k Exp-Golomb coding.
+ *
+ * The order-0 coder above is tuned for residuals clustered tightly
+ * around zero.  When the low-order bits of a residual stream carry
+ * little structure (as is common once deltas start to spread out),
+ * Golomb-Rice-style order-k coding does better: the low k bits of
+ * the magnitude are emitted verbatim instead of being folded into
+ * the unary prefix, which keeps the prefix short regardless of k.
+ *
+ * Encoding of a magnitude n (item with the sign removed):
+ *   q = n >> k
+ *   emit q zero bits, then a 1, then the k low bits of n,
+ *   then a sign bit (omitted for n == 0).
+ *
+ * k == 0 falls back to the order-0 scheme implemented above.
+ *
+ * q grows linearly with n for any fixed k, so a magnitude far larger
+ * than k was chosen for would otherwise emit an unbounded run of
+ * zero bits.  Past maxUnaryRun, addK escapes to a fixed-width
+ * encoding of n instead; see addK below.
+ */
+
+package deltagolomb
+
+import (
+	"bytes"
+	"io"
+)
+
+// maxK is the largest order-k value these constructors accept. k is
+// used directly as a bit-shift and bit-count throughout addK/Read;
+// a negative k wraps to an enormous value once cast to uint, and
+// either a negative or implausibly large k drives addBits/s.remaining
+// into an effectively unbounded loop rather than a bounded one. k
+// outside [0, maxK] is clamped rather than erroring, matching
+// NewBlockEncoder's treatment of an invalid blockSize.
+const maxK = 31
+
+func clampK(k int) int {
+	if k < 0 {
+		return 0
+	}
+	if k > maxK {
+		return maxK
+	}
+	return k
+}
+
+// Create a new order-k Exp-Golomb stream Encoder.  k is the number
+// of low-order magnitude bits emitted verbatim after the unary
+// prefix; k == 0 behaves exactly like NewExpGolombEncoder. k outside
+// [0, maxK] is clamped into range.
+func NewExpGolombEncoderK(w io.Writer, k int) *ExpGolombEncoder {
+	e := NewExpGolombEncoder(w)
+	e.k = clampK(k)
+	return e
+}
+
+// Create a new order-k Exp-Golomb stream decoder, matching the k
+// used by the corresponding NewExpGolombEncoderK. k outside
+// [0, maxK] is clamped into range.
+func NewExpGolombDecoderK(r io.Reader, k int) *ExpGolombDecoder {
+	d := NewExpGolombDecoder(r)
+	d.k = clampK(k)
+	return d
+}
+
+// maxUnaryRun caps the unary prefix addK will ever emit. q = n>>k is
+// linear in n's magnitude for any fixed k, so without a cap a
+// billion-scale value coded with a conservative k burns megabytes of
+// zero padding, and an extreme enough n relative to k drives the
+// unary run effectively unbounded (q can reach ~2^63). Past the cap,
+// addK emits maxUnaryRun zero bits and the usual terminating 1, then
+// escapes to a fixed-width encoding of the full magnitude instead of
+// q plus k low bits.
+const (
+	maxUnaryRun = 48
+	escapeBits  = 64
+)
+
+// addK implements order-k encoding of a single value; called by
+// add() whenever s.k > 0.
+func (s *ExpGolombEncoder) addK(item int) {
+	sign := uint(0)
+	if item < 0 {
+		sign = 1
+		item = -item
+	}
+
+	n := uint(item)
+	k := uint(s.k)
+	q := n >> k
+	if q >= maxUnaryRun {
+		s.addZeroBits(maxUnaryRun)
+		s.addBits(1, 1)
+		s.addBits(n, escapeBits)
+	} else {
+		s.addZeroBits(q)
+		s.addBits(1, 1)
+		if k > 0 {
+			low := n & ((uint(1) << k) - 1)
+			s.addBits(low, k)
+		}
+	}
+	if item != 0 {
+		s.addBits(sign, 1)
+	}
+}
+
+// Delta encodes an array of integers using order-k Exp-Golomb on
+// the residuals.  See DeltaEncode for the non-order-k variant.
+func DeltaEncodeK(start int, k int, data []int) []byte {
+	bytestream := &bytes.Buffer{}
+	egs := NewExpGolombEncoderK(bytestream, k)
+
+	prev := start
+	for _, i := range data {
+		delta := i - prev
+		prev = i
+		egs.Write([]int{delta})
+	}
+	egs.Close()
+
+	return bytestream.Bytes()
+}
+
+// Decodes an order-k Exp-Golomb encoded stream of delta residuals.
+// k must match the value passed to DeltaEncodeK.
+func DeltaDecodeK(base int, k int, compressed []byte) []int {
+	res := make([]int, 0)
+	val := base
+	decoder := NewExpGolombDecoderK(bytes.NewBuffer(compressed), k)
+
+	tmp := make([]int, 1)
+	for {
+		n, err := decoder.Read(tmp)
+		if n > 0 {
+			val = val + tmp[0]
+			res = append(res, val)
+		}
+		if err != nil {
+			return res
+		}
+	}
+}
+
+// PickK scans the magnitudes of data and returns the order-k value
+// expected to minimize the total coded length of an order-k
+// Exp-Golomb stream over those values.  Intended for use on delta
+// residuals, whose magnitude distribution dictates the best k.
+func PickK(data []int) int {
+	bestK := 0
+	bestBits := -1
+
+	for k := 0; k <= 31; k++ {
+		bits := 0
+		for _, v := range data {
+			n := v
+			if n < 0 {
+				n = -n
+			}
+			switch {
+			case k == 0:
+				// k == 0 is coded by the order-0 scheme (see add).
+				bits += 2*bitLen(uint(n)+1) - 1
+			case n>>uint(k) >= maxUnaryRun:
+				// addK's fixed-width escape.
+				bits += maxUnaryRun + 1 + escapeBits
+			default:
+				bits += (n >> uint(k)) + 1 + k
+			}
+			if n != 0 {
+				bits++
+			}
+		}
+		if bestBits < 0 || bits < bestBits {
+			bestBits = bits
+			bestK = k
+		}
+	}
+	return bestK
+}
+
+// DeltaEncodeAutoK delta-encodes data, picks the order-k parameter
+// that minimizes the expected coded length of the residuals via
+// PickK, and prepends k as a one-byte header so DeltaDecodeAutoK
+// can recover it.
+func DeltaEncodeAutoK(start int, data []int) []byte {
+	deltas := make([]int, len(data))
+	prev := start
+	for i, v := range data {
+		deltas[i] = v - prev
+		prev = v
+	}
+
+	k := PickK(deltas)
+
+	bytestream := &bytes.Buffer{}
+	bytestream.WriteByte(byte(k))
+	egs := NewExpGolombEncoderK(bytestream, k)
+	egs.Write(deltas)
+	egs.Close()
+
+	return bytestream.Bytes()
+}
+
+// Decodes a stream produced by DeltaEncodeAutoK, reading k back out
+// of the one-byte header.
+func DeltaDecodeAutoK(base int, compressed []byte) []int {
+	if len(compressed) == 0 {
+		return []int{}
+	}
+	k := int(compressed[0])
+	return DeltaDecodeK(base, k, compressed[1:])
+}
@@ -0,0 +1,134 @@
+package deltagolomb
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestExpGolombKEncodeDecode(t *testing.T) {
+	vals := make([]int, 513)
+	for i := range vals {
+		vals[i] = rand.Intn(1 << 20)
+		if i%2 == 0 {
+			vals[i] = -vals[i]
+		}
+	}
+
+	for k := 0; k <= 20; k++ {
+		buf := &bytes.Buffer{}
+		encoder := NewExpGolombEncoderK(buf, k)
+		encoder.Write(vals)
+		encoder.Close()
+
+		decoder := NewExpGolombDecoderK(buf, k)
+		res := make([]int, len(vals))
+		n, _ := decoder.Read(res)
+		if n != len(vals) {
+			t.Fatalf("k=%d: expected %d values, got %d", k, len(vals), n)
+		}
+		for i, exp := range vals {
+			if res[i] != exp {
+				t.Fatalf("k=%d: item %d was %d, expected %d", k, i, res[i], exp)
+			}
+		}
+	}
+}
+
+// TestExpGolombKLargeMagnitudeDoesNotHang exercises addK's escape
+// path: q = n>>k grows linearly with n's magnitude for any fixed k,
+// so a large value under a small k used to make WriteInt emit on the
+// order of 10^18 zero bits instead of returning. Each of these values
+// makes q exceed maxUnaryRun at k=1 and must round-trip via the
+// fixed-width escape instead.
+func TestExpGolombKLargeMagnitudeDoesNotHang(t *testing.T) {
+	vals := []int{math.MaxInt64 / 2, -(math.MaxInt64 / 2), 1 << 40, -(1 << 40)}
+
+	buf := &bytes.Buffer{}
+	enc := NewExpGolombEncoderK(buf, 1)
+	enc.Write(vals)
+	enc.Close()
+
+	if buf.Len() > 1024 {
+		t.Fatalf("encoded %d bytes for %d values, want a few dozen", buf.Len(), len(vals))
+	}
+
+	dec := NewExpGolombDecoderK(buf, 1)
+	got := make([]int, len(vals))
+	n, err := dec.Read(got)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if n != len(vals) {
+		t.Fatalf("got %d values, want %d", n, len(vals))
+	}
+	for i, v := range vals {
+		if got[i] != v {
+			t.Fatalf("item %d was %d, want %d", i, got[i], v)
+		}
+	}
+}
+
+// TestExpGolombKClampsK confirms a k outside [0, maxK] -- including a
+// negative one, which wraps to an enormous uint once cast -- is
+// clamped into range instead of driving the encoder/decoder into an
+// effectively unbounded loop.
+func TestExpGolombKClampsK(t *testing.T) {
+	for _, k := range []int{-1, -1000, maxK + 1, 1000} {
+		buf := &bytes.Buffer{}
+		enc := NewExpGolombEncoderK(buf, k)
+		enc.WriteInt(42)
+		enc.Close()
+
+		dec := NewExpGolombDecoderK(buf, k)
+		got := make([]int, 1)
+		n, err := dec.Read(got)
+		if err != nil {
+			t.Fatalf("k=%d: Read: %v", k, err)
+		}
+		if n != 1 || got[0] != 42 {
+			t.Fatalf("k=%d: got %v, want [42]", k, got[:n])
+		}
+	}
+}
+
+func TestDeltaEncodeDecodeK(t *testing.T) {
+	o := make([]int, 50)
+	base := 1000
+	for i := range o {
+		o[i] = base + i*i
+	}
+
+	for k := 0; k <= 10; k++ {
+		e := DeltaEncodeK(base, k, o)
+		d := DeltaDecodeK(base, k, e)
+		if len(d) != len(o) {
+			t.Fatalf("k=%d: len(d) = %d, want %d", k, len(d), len(o))
+		}
+		for i := range o {
+			if d[i] != o[i] {
+				t.Fatalf("k=%d: item %d mismatch, want %d got %d", k, i, o[i], d[i])
+			}
+		}
+	}
+}
+
+func TestDeltaEncodeAutoK(t *testing.T) {
+	base := 42
+	o := make([]int, 200)
+	for i := range o {
+		o[i] = base + i*500 + rand.Intn(17)
+	}
+
+	e := DeltaEncodeAutoK(base, o)
+	d := DeltaDecodeAutoK(base, e)
+	if len(d) != len(o) {
+		t.Fatalf("len(d) = %d, want %d", len(d), len(o))
+	}
+	for i := range o {
+		if d[i] != o[i] {
+			t.Fatalf("item %d mismatch, want %d got %d", i, o[i], d[i])
+		}
+	}
+}
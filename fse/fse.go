@@ -0,0 +1,468 @@
+/*
+ * Package fse implements a Finite State Entropy (tANS) coder, an
+ * alternative to deltagolomb's order-0/order-k Exp-Golomb coding for
+ * residual streams whose symbol distribution is concentrated on a
+ * handful of common values rather than tightly clustered near zero.
+ * The API mirrors the shape of the parent package:
+ *
+ * encoder := fse.NewEncoder(w)
+ * encoder.Write([]int{0, 0, 1, 1})
+ * encoder.Close()
+ *
+ * decoder := fse.NewDecoder(r)
+ * decoder.Read(buf)
+ *
+ * Unlike Exp-Golomb, a tANS table has to be built from the complete
+ * symbol histogram before any state can be emitted, and symbols are
+ * logically pushed onto the coder in reverse order.  So the encoder
+ * just buffers its input and does the real work in Close(), and the
+ * decoder decodes its entire input the first time Read is called and
+ * then serves values out of an internal buffer.
+ */
+package fse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"sort"
+)
+
+const (
+	tableLog  = 12
+	tableSize = 1 << tableLog
+)
+
+// Encoding modes, written as a single byte right after the element
+// count.  modeTANS is the normal path; modeRaw is a fallback for
+// streams with more distinct symbols than the table has slots for
+// (see FSEEncode).
+const (
+	modeTANS byte = iota
+	modeRaw
+)
+
+// Encode a slice of signed integers with the FSE coder.  Values are
+// zig-zag mapped to unsigned symbols first, so small magnitudes
+// (positive or negative) are cheap regardless of sign, the same as
+// the delta residuals this coder is meant to be used on.
+func FSEEncode(residuals []int) []byte {
+	var buf bytes.Buffer
+	writeUvarint(&buf, uint64(len(residuals)))
+
+	if len(residuals) == 0 {
+		return buf.Bytes()
+	}
+
+	zz := make([]uint64, len(residuals))
+	for i, v := range residuals {
+		zz[i] = zigzag(v)
+	}
+
+	hist := make(map[uint64]int, len(zz))
+	for _, s := range zz {
+		hist[s]++
+	}
+
+	if len(hist) > tableSize {
+		// A tableSize-slot table can't give every distinct symbol
+		// its own slot, which normalize's count-stealing loop
+		// assumes is always possible; fall back to writing the
+		// zig-zagged symbols uncoded rather than trying to spread
+		// more symbols than there is room for.
+		buf.WriteByte(modeRaw)
+		for _, s := range zz {
+			writeUvarint(&buf, s)
+		}
+		return buf.Bytes()
+	}
+	buf.WriteByte(modeTANS)
+
+	norm := normalize(hist, len(zz))
+	syms := sortedSymbols(norm)
+	cumul := cumulative(norm, syms)
+	spread := spreadTable(norm, syms)
+	tt := buildSymbolTransforms(norm, cumul)
+	stateTable := buildStateTable(cumul, spread)
+
+	writeUvarint(&buf, uint64(len(syms)))
+	for _, s := range syms {
+		writeUvarint(&buf, s)
+		writeUvarint(&buf, uint64(norm[s]))
+	}
+
+	// Symbols are logically pushed onto the coder starting from the
+	// end of the stream; the very first push (the last residual) is
+	// free, seeding the state directly from the table with no bits
+	// written. The remaining pushes each emit a chunk of bits.
+	n := len(zz)
+	state := stateTable[cumul[zz[n-1]]]
+
+	type bitChunk struct {
+		bits uint32
+		n    uint
+	}
+	chunks := make([]bitChunk, 0, n-1)
+	for i := n - 2; i >= 0; i-- {
+		t := tt[zz[i]]
+		nbBitsOut := uint((int64(state) + t.deltaNbBits) >> 16)
+		low := state & ((uint32(1) << nbBitsOut) - 1)
+		chunks = append(chunks, bitChunk{low, nbBitsOut})
+		idx := (state >> nbBitsOut) + uint32(t.deltaFindState)
+		state = stateTable[idx]
+	}
+
+	// Popping happens in the opposite order from pushing, so the
+	// chunks have to be replayed back to front for the decoder's
+	// forward read to reproduce the original symbol order.
+	bw := &bitWriter{}
+	for i := len(chunks) - 1; i >= 0; i-- {
+		bw.addBits(chunks[i].bits, chunks[i].n)
+	}
+
+	var stateBytes [4]byte
+	binary.BigEndian.PutUint32(stateBytes[:], state)
+	buf.Write(stateBytes[:])
+	buf.Write(bw.finish())
+
+	return buf.Bytes()
+}
+
+// Decode a byte stream produced by FSEEncode back into the original
+// signed integers.
+func FSEDecode(data []byte) []int {
+	r := bytes.NewReader(data)
+
+	n64, _ := binary.ReadUvarint(r)
+	n := int(n64)
+	if n == 0 {
+		return []int{}
+	}
+
+	mode, _ := r.ReadByte()
+	if mode == modeRaw {
+		out := make([]int, n)
+		for i := 0; i < n; i++ {
+			s64, _ := binary.ReadUvarint(r)
+			out[i] = unzigzag(s64)
+		}
+		return out
+	}
+
+	nSym64, _ := binary.ReadUvarint(r)
+	nSym := int(nSym64)
+	norm := make(map[uint64]int, nSym)
+	syms := make([]uint64, nSym)
+	for i := 0; i < nSym; i++ {
+		s64, _ := binary.ReadUvarint(r)
+		c64, _ := binary.ReadUvarint(r)
+		syms[i] = s64
+		norm[s64] = int(c64)
+	}
+
+	spread := spreadTable(norm, syms)
+	decTable := buildDecodeTable(norm, spread)
+
+	var stateBytes [4]byte
+	io.ReadFull(r, stateBytes[:])
+	// The transmitted value is the encoder's final physical state,
+	// in [tableSize, 2*tableSize); converting it once to table-index
+	// space ([0, tableSize)) here means every later lookup below can
+	// index decTable directly, since newBase is already index-space.
+	state := binary.BigEndian.Uint32(stateBytes[:]) - tableSize
+
+	payload, _ := io.ReadAll(r)
+	br := &bitReader{buf: payload}
+
+	out := make([]int, n)
+	out[0] = unzigzag(decTable[state].symbol)
+	for i := 1; i < n; i++ {
+		e := decTable[state]
+		low := br.readBits(e.nbBits)
+		state = e.newBase + low
+		out[i] = unzigzag(decTable[state].symbol)
+	}
+
+	return out
+}
+
+// Encoder buffers integers written via Write/WriteInt and performs
+// the actual FSE encode on Close, writing the result to the wrapped
+// io.Writer.
+type Encoder struct {
+	out  io.Writer
+	vals []int
+}
+
+// Create a new FSE stream encoder.  Accepts integers via Write and
+// WriteInt; the coded bytes are not written to w until Close.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{out: w}
+}
+
+func (e *Encoder) Write(ilist []int) {
+	e.vals = append(e.vals, ilist...)
+}
+
+func (e *Encoder) WriteInt(i int) {
+	e.vals = append(e.vals, i)
+}
+
+func (e *Encoder) Close() error {
+	_, err := e.out.Write(FSEEncode(e.vals))
+	return err
+}
+
+// Decoder decodes its entire input on the first call to Read, then
+// serves the result incrementally, mirroring ExpGolombDecoder.Read.
+type Decoder struct {
+	r    io.Reader
+	vals []int
+	pos  int
+	done bool
+}
+
+// Create a new FSE stream decoder reading from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+func (d *Decoder) Read(out []int) (int, error) {
+	if !d.done {
+		raw, err := io.ReadAll(d.r)
+		if err != nil {
+			return 0, err
+		}
+		d.vals = FSEDecode(raw)
+		d.done = true
+	}
+
+	n := copy(out, d.vals[d.pos:])
+	d.pos += n
+	if n == 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+func zigzag(n int) uint64 {
+	x := int64(n)
+	return uint64((x << 1) ^ (x >> 63))
+}
+
+func unzigzag(u uint64) int {
+	return int(int64(u>>1) ^ -int64(u&1))
+}
+
+func writeUvarint(buf *bytes.Buffer, v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	buf.Write(tmp[:n])
+}
+
+// normalize rescales the raw symbol histogram to counts that sum to
+// exactly tableSize, using the standard fast-normalization that
+// reserves at least one slot for every symbol that was actually
+// seen, nudging the most frequent symbols to absorb the remainder.
+func normalize(hist map[uint64]int, total int) map[uint64]int {
+	type symCount struct {
+		sym uint64
+		c   int
+	}
+	list := make([]symCount, 0, len(hist))
+	for s, c := range hist {
+		list = append(list, symCount{s, c})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].c > list[j].c })
+
+	norm := make(map[uint64]int, len(list))
+	remaining := tableSize
+	for _, e := range list {
+		n := e.c * tableSize / total
+		if n < 1 {
+			n = 1
+		}
+		norm[e.sym] = n
+		remaining -= n
+	}
+
+	for i := 0; remaining != 0; i = (i + 1) % len(list) {
+		s := list[i].sym
+		if remaining > 0 {
+			norm[s]++
+			remaining--
+		} else if norm[s] > 1 {
+			norm[s]--
+			remaining++
+		}
+	}
+	return norm
+}
+
+func sortedSymbols(norm map[uint64]int) []uint64 {
+	syms := make([]uint64, 0, len(norm))
+	for s := range norm {
+		syms = append(syms, s)
+	}
+	sort.Slice(syms, func(i, j int) bool { return syms[i] < syms[j] })
+	return syms
+}
+
+// cumulative returns, for each symbol, the running total of
+// normalized counts of all symbols before it in syms order.
+func cumulative(norm map[uint64]int, syms []uint64) map[uint64]int {
+	cumul := make(map[uint64]int, len(syms))
+	total := 0
+	for _, s := range syms {
+		cumul[s] = total
+		total += norm[s]
+	}
+	return cumul
+}
+
+// spreadTable lays symbols out across the tableSize slots using the
+// standard FSE spread step, so that equal-count symbols end up
+// roughly evenly interleaved rather than in contiguous runs.
+func spreadTable(norm map[uint64]int, syms []uint64) []uint64 {
+	table := make([]uint64, tableSize)
+	step := (tableSize >> 1) + (tableSize >> 3) + 3
+	mask := uint32(tableSize - 1)
+
+	pos := uint32(0)
+	for _, s := range syms {
+		for i := 0; i < norm[s]; i++ {
+			table[pos] = s
+			pos = (pos + uint32(step)) & mask
+		}
+	}
+	return table
+}
+
+func highBit(v uint32) uint {
+	var n uint
+	for v > 1 {
+		v >>= 1
+		n++
+	}
+	return n
+}
+
+type symbolTransform struct {
+	deltaNbBits    int64
+	deltaFindState int
+}
+
+// buildSymbolTransforms computes, per symbol, the (nbBits, newState)
+// transform coefficients used by the encoder's state transitions.
+func buildSymbolTransforms(norm map[uint64]int, cumul map[uint64]int) map[uint64]symbolTransform {
+	tt := make(map[uint64]symbolTransform, len(norm))
+	for s, count := range norm {
+		maxBitsOut := tableLog - highBit(uint32(count-1))
+		minStatePlus := int64(count) << maxBitsOut
+		tt[s] = symbolTransform{
+			deltaNbBits:    int64(maxBitsOut)<<16 - minStatePlus,
+			deltaFindState: cumul[s] - count,
+		}
+	}
+	return tt
+}
+
+// buildStateTable maps each "virtual position" (a symbol's cumulative
+// count plus its occurrence index) to the physical next-state value
+// used by the encoder.
+func buildStateTable(cumul map[uint64]int, spread []uint64) []uint32 {
+	stateTable := make([]uint32, tableSize)
+	next := make(map[uint64]int, len(cumul))
+	for s, c := range cumul {
+		next[s] = c
+	}
+	for x := 0; x < tableSize; x++ {
+		s := spread[x]
+		stateTable[next[s]] = uint32(tableSize + x)
+		next[s]++
+	}
+	return stateTable
+}
+
+type decodeEntry struct {
+	symbol  uint64
+	nbBits  uint
+	newBase uint32
+}
+
+// buildDecodeTable is the decoder's counterpart to buildStateTable.
+// For each physical state it records the symbol that was pushed to
+// reach it and how to recover the state that preceded that push.
+// Unlike buildStateTable, the per-symbol counter here starts at the
+// symbol's own normalized count (its local virtual-state range is
+// [count, 2*count)), not at the symbol's global cumulative offset.
+func buildDecodeTable(norm map[uint64]int, spread []uint64) []decodeEntry {
+	table := make([]decodeEntry, tableSize)
+	next := make(map[uint64]int, len(norm))
+	for s, c := range norm {
+		next[s] = c
+	}
+	for x := 0; x < tableSize; x++ {
+		s := spread[x]
+		pos := uint32(next[s])
+		next[s]++
+		nbBits := tableLog - highBit(pos)
+		table[x] = decodeEntry{
+			symbol:  s,
+			nbBits:  nbBits,
+			newBase: (pos << nbBits) - uint32(tableSize),
+		}
+	}
+	return table
+}
+
+// bitWriter is a minimal MSB-first bit packer, in the same spirit as
+// ExpGolombEncoder.addBits in the parent package.
+type bitWriter struct {
+	buf   []byte
+	cur   byte
+	nbits uint
+}
+
+func (w *bitWriter) addBits(bits uint32, n uint) {
+	for i := int(n) - 1; i >= 0; i-- {
+		w.cur = (w.cur << 1) | byte((bits>>uint(i))&1)
+		w.nbits++
+		if w.nbits == 8 {
+			w.buf = append(w.buf, w.cur)
+			w.cur = 0
+			w.nbits = 0
+		}
+	}
+}
+
+func (w *bitWriter) finish() []byte {
+	if w.nbits > 0 {
+		w.cur <<= 8 - w.nbits
+		w.buf = append(w.buf, w.cur)
+	}
+	return w.buf
+}
+
+type bitReader struct {
+	buf []byte
+	pos int
+	bit uint
+}
+
+func (r *bitReader) readBits(n uint) uint32 {
+	var v uint32
+	for i := uint(0); i < n; i++ {
+		var bit uint32
+		if r.pos < len(r.buf) {
+			bit = uint32((r.buf[r.pos] >> (7 - r.bit)) & 1)
+			r.bit++
+			if r.bit == 8 {
+				r.bit = 0
+				r.pos++
+			}
+		}
+		v = (v << 1) | bit
+	}
+	return v
+}
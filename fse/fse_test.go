@@ -0,0 +1,99 @@
+package fse
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestFSEEncodeDecode(t *testing.T) {
+	cases := [][]int{
+		{},
+		{0},
+		{0, 0, 0, 0, 1},
+		{5, -5, 5, -5, 5, 0, 0, 0, 0, 0, 0, 0, 1},
+	}
+	for _, vals := range cases {
+		encoded := FSEEncode(vals)
+		decoded := FSEDecode(encoded)
+		if len(decoded) != len(vals) {
+			t.Fatalf("%v: got %d values, want %d", vals, len(decoded), len(vals))
+		}
+		for i, v := range vals {
+			if decoded[i] != v {
+				t.Fatalf("%v: item %d was %d, want %d", vals, i, decoded[i], v)
+			}
+		}
+	}
+}
+
+func TestFSEEncodeDecodeSkewedRandom(t *testing.T) {
+	vals := make([]int, 2000)
+	for i := range vals {
+		// A skewed distribution, typical of delta residuals: mostly
+		// small values with an occasional large outlier.
+		switch {
+		case rand.Intn(10) == 0:
+			vals[i] = rand.Intn(2000) - 1000
+		default:
+			vals[i] = rand.Intn(5) - 2
+		}
+	}
+
+	decoded := FSEDecode(FSEEncode(vals))
+	if len(decoded) != len(vals) {
+		t.Fatalf("got %d values, want %d", len(decoded), len(vals))
+	}
+	for i, v := range vals {
+		if decoded[i] != v {
+			t.Fatalf("item %d was %d, want %d", i, decoded[i], v)
+		}
+	}
+}
+
+// TestFSEEncodeDecodeManyDistinctSymbols exercises the raw fallback
+// path: with more distinct zig-zagged symbols than tableSize, the
+// normal table-normalization step can't give every symbol a slot, so
+// FSEEncode must fall back instead of spinning in normalize.
+func TestFSEEncodeDecodeManyDistinctSymbols(t *testing.T) {
+	vals := make([]int, 6000)
+	for i := range vals {
+		vals[i] = i
+	}
+
+	decoded := FSEDecode(FSEEncode(vals))
+	if len(decoded) != len(vals) {
+		t.Fatalf("got %d values, want %d", len(decoded), len(vals))
+	}
+	for i, v := range vals {
+		if decoded[i] != v {
+			t.Fatalf("item %d was %d, want %d", i, decoded[i], v)
+		}
+	}
+}
+
+func TestEncoderDecoder(t *testing.T) {
+	vals := []int{0, 0, 1, -1, 2, -2, 3, 3, 3, 0}
+
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	enc.Write(vals)
+	if err := enc.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	dec := NewDecoder(buf)
+	res := make([]int, len(vals))
+	n, err := dec.Read(res)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if n != len(vals) {
+		t.Fatalf("got %d values, want %d", n, len(vals))
+	}
+	for i, v := range vals {
+		if res[i] != v {
+			t.Fatalf("item %d was %d, want %d", i, res[i], v)
+		}
+	}
+}